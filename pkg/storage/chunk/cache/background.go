@@ -0,0 +1,356 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"flag"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+// BackgroundConfig is config for a Background Cache.
+type BackgroundConfig struct {
+	WriteBackGoroutines int `yaml:"writeback_goroutines"`
+	WriteBackBuffer     int `yaml:"writeback_buffer"`
+
+	// EnableSingleflight collapses concurrent Fetch calls for the same set of
+	// keys into a single call to the wrapped cache, so a stampede of misses
+	// for the same key only costs one backend round trip.
+	EnableSingleflight bool `yaml:"enable_singleflight"`
+
+	// EnableEarlyRefresh turns on XFetch-style probabilistic early expiry:
+	// as a found entry approaches EarlyRefreshTTL it is occasionally reported
+	// as missing so the caller recomputes and re-Stores it before it actually
+	// expires, spreading out what would otherwise be a thundering herd at
+	// expiry time.
+	EnableEarlyRefresh bool `yaml:"enable_early_refresh"`
+	// EarlyRefreshTTL is the validity assumed for entries passing through this
+	// cache; it should match the wrapped backend's own expiration setting.
+	EarlyRefreshTTL time.Duration `yaml:"early_refresh_ttl"`
+	// EarlyRefreshBeta tunes how aggressively entries are refreshed early;
+	// higher values trigger recomputation further ahead of actual expiry.
+	EarlyRefreshBeta float64 `yaml:"early_refresh_beta"`
+	// EarlyRefreshMaxTrackedKeys bounds the number of keys whose TTL/delta
+	// bookkeeping is kept in memory for early refresh; the oldest tracked key
+	// is evicted once this is exceeded, since Loki's key space is effectively
+	// unbounded over a process lifetime.
+	EarlyRefreshMaxTrackedKeys int `yaml:"early_refresh_max_tracked_keys"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *BackgroundConfig) RegisterFlagsWithPrefix(prefix, description string, f *flag.FlagSet) {
+	f.IntVar(&cfg.WriteBackGoroutines, prefix+"background.write-back-concurrency", 10, description+"At what concurrency to write back to cache.")
+	f.IntVar(&cfg.WriteBackBuffer, prefix+"background.write-back-buffer", 10000, description+"How many key batches to buffer for background write-back.")
+	f.BoolVar(&cfg.EnableSingleflight, prefix+"background.enable-singleflight", false, description+"Collapse concurrent Fetch calls for the same keys into a single backend call.")
+	f.BoolVar(&cfg.EnableEarlyRefresh, prefix+"background.enable-early-refresh", false, description+"Probabilistically report entries as missing shortly before they expire, to avoid a stampede of recomputation at exact expiry.")
+	f.DurationVar(&cfg.EarlyRefreshTTL, prefix+"background.early-refresh-ttl", 0, description+"Validity to assume for cached entries when early refresh is enabled; should match the wrapped backend's own expiration.")
+	f.Float64Var(&cfg.EarlyRefreshBeta, prefix+"background.early-refresh-beta", 1.0, description+"Beta factor for the XFetch early refresh probability; higher values refresh earlier.")
+	f.IntVar(&cfg.EarlyRefreshMaxTrackedKeys, prefix+"background.early-refresh-max-tracked-keys", 1000000, description+"Maximum number of keys to track TTL/compute-cost bookkeeping for when early refresh is enabled.")
+}
+
+// backgroundCache stores async methods for writing to a cache, so that cache
+// writes don't block the response path for anything that doesn't need them to.
+type backgroundCache struct {
+	Cache
+
+	cfg BackgroundConfig
+
+	wg       sync.WaitGroup
+	quit     chan struct{}
+	bgWrites chan backgroundWrite
+
+	name string
+
+	sfGroup singleflight.Group
+	xfetch  xfetchTracker
+
+	droppedWriteBack prometheus.Counter
+	queueLength      prometheus.Gauge
+}
+
+type backgroundWrite struct {
+	keys []string
+	bufs [][]byte
+	gen  string
+}
+
+// xfetchTracker remembers, per key, enough to compute the XFetch early
+// refresh probability: when the entry is due to expire, and how expensive it
+// was to (re)compute the last time it was missing. Loki's cache key space is
+// effectively unbounded over a process lifetime, so entries are kept on an
+// LRU list capped at maxKeys rather than left to grow forever.
+type xfetchTracker struct {
+	mtx     sync.Mutex
+	maxKeys int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type xfetchEntry struct {
+	key          string
+	expiry       time.Time
+	delta        time.Duration
+	missingSince time.Time
+}
+
+func newXfetchTracker(maxKeys int) xfetchTracker {
+	return xfetchTracker{
+		maxKeys: maxKeys,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// NewBackground returns a new Cache that writes asynchronously to the cache.
+func NewBackground(name string, cfg BackgroundConfig, cache Cache, reg prometheus.Registerer) Cache {
+	c := &backgroundCache{
+		Cache:    cache,
+		cfg:      cfg,
+		quit:     make(chan struct{}),
+		bgWrites: make(chan backgroundWrite, cfg.WriteBackBuffer),
+		name:     name,
+		xfetch:   newXfetchTracker(cfg.EarlyRefreshMaxTrackedKeys),
+
+		droppedWriteBack: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "dropped_background_writes_total",
+			Help:        "Total count of dropped write backs to cache.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		queueLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "background_queue_length",
+			Help:        "Length of the write-back queue.",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(c.droppedWriteBack, c.queueLength)
+	}
+
+	c.wg.Add(cfg.WriteBackGoroutines)
+	for i := 0; i < cfg.WriteBackGoroutines; i++ {
+		go c.writeBackLoop()
+	}
+
+	return c
+}
+
+// Store writes keys to the cache in the background. Only the cache gen number
+// is carried over from ctx; its deadline and cancellation are not, since the
+// caller may not wait.
+func (c *backgroundCache) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	if c.cfg.EnableEarlyRefresh {
+		c.xfetch.recordStore(keys, c.cfg.EarlyRefreshTTL)
+	}
+
+	bgWrite := backgroundWrite{
+		keys: keys,
+		bufs: bufs,
+		gen:  ExtractCacheGenNumber(ctx),
+	}
+	select {
+	case c.bgWrites <- bgWrite:
+		c.queueLength.Add(1)
+	default:
+		c.droppedWriteBack.Add(float64(len(keys)))
+	}
+}
+
+// Fetch looks keys up in the wrapped cache. When singleflight is enabled,
+// concurrent Fetches for the same key set collapse into one backend call.
+// When early refresh is enabled, entries nearing expiry are probabilistically
+// reported as missing so the caller recomputes them ahead of time, rather
+// than everyone recomputing the moment the entry actually expires.
+func (c *backgroundCache) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	if !c.cfg.EnableSingleflight {
+		return c.fetch(ctx, keys)
+	}
+
+	// The gen number (see InjectCacheGenNumber) is only applied inside the
+	// wrapped cache's own Fetch, so it must be folded into the singleflight
+	// key here too - otherwise two concurrent Fetches for the same raw keys
+	// but different tenants' gen numbers would collapse into one call and
+	// share whichever caller's result/gen happened to win the race.
+	groupKey := singleflightGroupKey(ExtractCacheGenNumber(ctx), keys)
+	v, _, _ := c.sfGroup.Do(groupKey, func() (interface{}, error) {
+		f, b, m := c.fetch(ctx, keys)
+		return fetchResult{found: f, bufs: b, missing: m}, nil
+	})
+	res := v.(fetchResult)
+	return res.found, res.bufs, res.missing
+}
+
+type fetchResult struct {
+	found   []string
+	bufs    [][]byte
+	missing []string
+}
+
+// singleflightGroupKey builds a singleflight key that distinguishes (gen,
+// keys) pairs unambiguously, even when a raw key contains whatever delimiter
+// a naive join would use - e.g. gen="" keys=["a,b"] and gen="" keys=["a","b"]
+// must not collide, or the caller that loses the singleflight race gets back
+// found/bufs/missing for a key set it never asked for. Each component is
+// length-prefixed, so no delimiter choice can make two distinct (gen, keys)
+// inputs produce the same group key.
+func singleflightGroupKey(gen string, keys []string) string {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(len(gen)) + ":" + gen)
+	for _, key := range keys {
+		sb.WriteString("|" + strconv.Itoa(len(key)) + ":" + key)
+	}
+	return sb.String()
+}
+
+func (c *backgroundCache) fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	found, bufs, missing = c.Cache.Fetch(ctx, keys)
+	if !c.cfg.EnableEarlyRefresh {
+		return
+	}
+	c.xfetch.recordMissing(missing)
+
+	keptFound := found[:0]
+	keptBufs := bufs[:0]
+	for i, key := range found {
+		if c.xfetch.shouldRefreshEarly(key, c.cfg.EarlyRefreshBeta) {
+			missing = append(missing, key)
+			continue
+		}
+		keptFound = append(keptFound, key)
+		keptBufs = append(keptBufs, bufs[i])
+	}
+	return keptFound, keptBufs, missing
+}
+
+func (c *backgroundCache) writeBackLoop() {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case bgWrite, ok := <-c.bgWrites:
+			if !ok {
+				return
+			}
+			c.queueLength.Add(-1)
+			c.Cache.Store(InjectCacheGenNumber(context.Background(), bgWrite.gen), bgWrite.keys, bgWrite.bufs)
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Stop the background flushing goroutines.
+func (c *backgroundCache) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+	level.Debug(util_log.Logger).Log("msg", "stopped background cache", "name", c.name)
+	c.Cache.Stop()
+}
+
+// shouldRefreshEarly implements the XFetch formula: treat a still-valid entry
+// as a miss with probability that increases the closer it gets to expiry and
+// the more expensive it was to compute last time. delta*beta*-ln(rand()) is
+// an estimate of how long a recompute started "now" would take to land
+// before the real expiry; once that estimate reaches or passes the actual
+// remaining TTL, we refresh early rather than risk everyone missing at once.
+func (x *xfetchTracker) shouldRefreshEarly(key string, beta float64) bool {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	element, ok := x.entries[key]
+	if !ok {
+		return false
+	}
+	entry := element.Value.(*xfetchEntry)
+	if entry.expiry.IsZero() {
+		return false
+	}
+
+	remaining := time.Until(entry.expiry)
+	if remaining <= 0 {
+		entry.missingSince = time.Now()
+		return true
+	}
+
+	r := rand.Float64()
+	if r <= 0 {
+		r = math.SmallestNonzeroFloat64
+	}
+	refreshScore := entry.delta.Seconds() * beta * -math.Log(r)
+	if refreshScore < remaining.Seconds() {
+		return false
+	}
+
+	entry.missingSince = time.Now()
+	return true
+}
+
+// recordMissing notes when each tracked key was reported missing by the
+// wrapped cache, so the next recordStore for it can measure the recompute.
+func (x *xfetchTracker) recordMissing(keys []string) {
+	now := time.Now()
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	for _, key := range keys {
+		if element, ok := x.entries[key]; ok {
+			element.Value.(*xfetchEntry).missingSince = now
+		}
+	}
+}
+
+// recordStore remembers when each key is due to expire, and - if the key was
+// previously reported missing (a real miss, or an early-refresh trigger) -
+// how long it took the caller to recompute and Store it. Tracked keys are
+// kept on an LRU list capped at maxKeys, evicting the least recently stored
+// key once the cap is reached, so this can't grow without bound.
+func (x *xfetchTracker) recordStore(keys []string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	for _, key := range keys {
+		if element, ok := x.entries[key]; ok {
+			entry := element.Value.(*xfetchEntry)
+			if !entry.missingSince.IsZero() {
+				entry.delta = now.Sub(entry.missingSince)
+				entry.missingSince = time.Time{}
+			}
+			entry.expiry = now.Add(ttl)
+			x.lru.MoveToFront(element)
+			continue
+		}
+
+		entry := &xfetchEntry{key: key, expiry: now.Add(ttl)}
+		element := x.lru.PushFront(entry)
+		x.entries[key] = element
+
+		if x.maxKeys > 0 {
+			for len(x.entries) > x.maxKeys {
+				oldest := x.lru.Back()
+				if oldest == nil {
+					break
+				}
+				x.lru.Remove(oldest)
+				delete(x.entries, oldest.Value.(*xfetchEntry).key)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestXfetchTrackerNeverRefreshesUntrackedKeys(t *testing.T) {
+	x := newXfetchTracker(0)
+	require.False(t, x.shouldRefreshEarly("unknown", 1.0))
+}
+
+func TestXfetchTrackerRefreshesExpiredEntries(t *testing.T) {
+	x := newXfetchTracker(0)
+	x.recordStore([]string{"foo"}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	require.True(t, x.shouldRefreshEarly("foo", 1.0))
+}
+
+func TestXfetchTrackerRecordsComputeDelta(t *testing.T) {
+	x := newXfetchTracker(0)
+	x.recordStore([]string{"foo"}, time.Minute)
+	x.entries["foo"].Value.(*xfetchEntry).missingSince = time.Now().Add(-time.Second)
+
+	x.recordStore([]string{"foo"}, time.Minute)
+
+	entry := x.entries["foo"].Value.(*xfetchEntry)
+	require.True(t, entry.missingSince.IsZero())
+	require.GreaterOrEqual(t, entry.delta, time.Second)
+}
+
+func TestSingleflightGroupKeyDistinguishesKeysContainingSeparator(t *testing.T) {
+	joined := singleflightGroupKey("", []string{"a,b"})
+	split := singleflightGroupKey("", []string{"a", "b"})
+	require.NotEqual(t, joined, split, "a single key containing the old separator must not collide with the split keys")
+}
+
+func TestSingleflightGroupKeyDistinguishesGenNumbers(t *testing.T) {
+	gen1 := singleflightGroupKey("1", []string{"foo"})
+	gen2 := singleflightGroupKey("2", []string{"foo"})
+	require.NotEqual(t, gen1, gen2)
+}
+
+func TestXfetchTrackerEvictsOldestWhenOverCapacity(t *testing.T) {
+	x := newXfetchTracker(2)
+	x.recordStore([]string{"a"}, time.Minute)
+	x.recordStore([]string{"b"}, time.Minute)
+	x.recordStore([]string{"c"}, time.Minute)
+
+	require.Len(t, x.entries, 2)
+	_, ok := x.entries["a"]
+	require.False(t, ok, "oldest tracked key should have been evicted")
+	_, ok = x.entries["c"]
+	require.True(t, ok)
+}
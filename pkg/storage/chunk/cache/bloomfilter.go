@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"time"
+
+	bloom "github.com/bits-and-blooms/bloom/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BloomConfig configures the negative-cache bloom filter wrapper.
+type BloomConfig struct {
+	// ExpectedElements sizes the filter; it should be roughly the number of
+	// distinct absent keys expected to be marked between rotations.
+	ExpectedElements uint `yaml:"expected_elements"`
+	// FalsePositiveRate is the target false-positive rate for the filter.
+	// A false positive masks a key that is genuinely present (or could still
+	// become present) as missing, since Fetch short-circuits straight to
+	// "missing" for any key the filter claims to know about, without ever
+	// consulting the wrapped cache. That mistake persists until the next
+	// RotationInterval, so this should be set low enough that the induced
+	// miss rate stays well below the lookups the filter is meant to save.
+	FalsePositiveRate float64 `yaml:"false_positive_rate"`
+	// RotationInterval rebuilds the filter from scratch on this cadence, so
+	// negatives that have since become valid keys (or were simply noise)
+	// don't accumulate and push up the effective false-positive rate forever.
+	RotationInterval time.Duration `yaml:"rotation_interval"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *BloomConfig) RegisterFlagsWithPrefix(prefix, description string, f *flag.FlagSet) {
+	f.UintVar(&cfg.ExpectedElements, prefix+"bloom.expected-elements", 1000000, description+"Expected number of absent keys to be marked before the filter is rotated.")
+	f.Float64Var(&cfg.FalsePositiveRate, prefix+"bloom.false-positive-rate", 0.01, description+"Target false-positive rate of the negative cache bloom filter.")
+	f.DurationVar(&cfg.RotationInterval, prefix+"bloom.rotation-interval", time.Hour, description+"How often to rebuild the bloom filter, to shed stale negatives.")
+}
+
+// BloomFilter wraps a Cache with a bloom-filter-backed negative cache, to
+// protect the wrapped cache (and whatever backs it, e.g. a chunk/index store)
+// from penetration: repeated lookups for keys that are known not to exist.
+type BloomFilter struct {
+	Cache
+
+	cfg BloomConfig
+
+	mtx    sync.RWMutex
+	filter *bloom.BloomFilter
+	quit   chan struct{}
+
+	shortCircuited prometheus.Counter
+	markedAbsent   prometheus.Counter
+	rotations      prometheus.Counter
+}
+
+// NewBloomFilter wraps cache with a bloom-filter-backed negative cache.
+func NewBloomFilter(cache Cache, cfg BloomConfig, reg prometheus.Registerer) *BloomFilter {
+	b := &BloomFilter{
+		Cache:  cache,
+		cfg:    cfg,
+		filter: bloom.NewWithEstimates(cfg.ExpectedElements, cfg.FalsePositiveRate),
+		quit:   make(chan struct{}),
+
+		shortCircuited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "querier",
+			Subsystem: "cache",
+			Name:      "bloom_short_circuited_total",
+			Help:      "Total number of Fetch keys short-circuited to missing by the bloom filter.",
+		}),
+		markedAbsent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "querier",
+			Subsystem: "cache",
+			Name:      "bloom_marked_absent_total",
+			Help:      "Total number of keys added to the bloom filter via MarkAbsent.",
+		}),
+		rotations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "querier",
+			Subsystem: "cache",
+			Name:      "bloom_rotations_total",
+			Help:      "Total number of times the bloom filter has been rebuilt.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(b.shortCircuited, b.markedAbsent, b.rotations)
+	}
+
+	if cfg.RotationInterval > 0 {
+		go b.rotateLoop()
+	}
+
+	return b
+}
+
+// Fetch first consults the bloom filter: keys it claims are absent short-
+// circuit straight to missing without touching the wrapped cache. Everything
+// else is looked up as normal.
+func (b *BloomFilter) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	candidates := keys[:0:0]
+
+	b.mtx.RLock()
+	for _, key := range keys {
+		// TestString true means the key is (probably) in the known-absent
+		// set, so we can skip the backend; false means it might still exist
+		// and needs a real lookup.
+		if b.filter.TestString(key) {
+			missing = append(missing, key)
+		} else {
+			candidates = append(candidates, key)
+		}
+	}
+	b.mtx.RUnlock()
+
+	b.shortCircuited.Add(float64(len(keys) - len(candidates)))
+	if len(candidates) == 0 {
+		return nil, nil, missing
+	}
+
+	found, bufs, stillMissing := b.Cache.Fetch(ctx, candidates)
+	missing = append(missing, stillMissing...)
+	return found, bufs, missing
+}
+
+// MarkAbsent records that keys are known not to exist in the underlying
+// store, so future Fetches for them short-circuit without a backend lookup.
+func (b *BloomFilter) MarkAbsent(keys []string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, key := range keys {
+		b.filter.AddString(key)
+	}
+	b.markedAbsent.Add(float64(len(keys)))
+}
+
+func (b *BloomFilter) rotateLoop() {
+	ticker := time.NewTicker(b.cfg.RotationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.mtx.Lock()
+			b.filter = bloom.NewWithEstimates(b.cfg.ExpectedElements, b.cfg.FalsePositiveRate)
+			b.mtx.Unlock()
+			b.rotations.Inc()
+		case <-b.quit:
+			return
+		}
+	}
+}
+
+// Stop stops the rotation loop and the wrapped cache.
+func (b *BloomFilter) Stop() {
+	close(b.quit)
+	b.Cache.Stop()
+}
+
+// AbsentMarker is implemented by caches that can record that keys are known
+// not to exist upstream, so future Fetches for them can short-circuit. Only
+// BloomFilter implements this today.
+type AbsentMarker interface {
+	MarkAbsent(keys []string)
+}
+
+// MarkKeysAbsent records keys as absent on cache if it (or one of the caches
+// it wraps, e.g. via Tiered or Instrument) supports AbsentMarker, and is a
+// no-op otherwise. Callers that look a key up in the store backing this
+// cache and find it genuinely doesn't exist should call this so the next
+// Fetch for the same key doesn't repeat that lookup.
+func MarkKeysAbsent(cache Cache, keys []string) {
+	switch c := cache.(type) {
+	case AbsentMarker:
+		c.MarkAbsent(keys)
+	case *instrumentedCache:
+		MarkKeysAbsent(c.Cache, keys)
+	case tiered:
+		for _, tier := range c {
+			MarkKeysAbsent(tier, keys)
+		}
+	}
+}
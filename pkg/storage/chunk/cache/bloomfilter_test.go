@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilterShortCircuitsMarkedAbsentKeys(t *testing.T) {
+	inner := NewFifoCache("test", FifoCacheConfig{}, nil)
+	defer inner.Stop()
+
+	b := NewBloomFilter(inner, BloomConfig{ExpectedElements: 100, FalsePositiveRate: 0.01}, nil)
+	defer b.Stop()
+
+	b.MarkAbsent([]string{"missing-key"})
+
+	found, bufs, missing := b.Fetch(context.Background(), []string{"missing-key"})
+	require.Empty(t, found)
+	require.Empty(t, bufs)
+	require.Equal(t, []string{"missing-key"}, missing)
+}
+
+func TestBloomFilterStillFetchesUnmarkedKeys(t *testing.T) {
+	inner := NewFifoCache("test", FifoCacheConfig{}, nil)
+	defer inner.Stop()
+
+	b := NewBloomFilter(inner, BloomConfig{ExpectedElements: 100, FalsePositiveRate: 0.01}, nil)
+	defer b.Stop()
+
+	inner.Store(context.Background(), []string{"present-key"}, [][]byte{[]byte("value")})
+
+	found, bufs, missing := b.Fetch(context.Background(), []string{"present-key"})
+	require.Equal(t, []string{"present-key"}, found)
+	require.Equal(t, [][]byte{[]byte("value")}, bufs)
+	require.Empty(t, missing)
+}
+
+func TestMarkKeysAbsentIsNoopWithoutAbsentMarker(t *testing.T) {
+	inner := NewFifoCache("test", FifoCacheConfig{}, nil)
+	defer inner.Stop()
+
+	require.NotPanics(t, func() { MarkKeysAbsent(inner, []string{"some-key"}) })
+}
+
+func TestNewWiresBloomFilterWhenEnabled(t *testing.T) {
+	cfg := Config{
+		EnableFifoCache:   true,
+		EnableBloomFilter: true,
+		Fifocache:         FifoCacheConfig{MaxSizeItems: 10},
+		Bloom:             BloomConfig{ExpectedElements: 100, FalsePositiveRate: 0.01},
+	}
+
+	c, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer c.Stop()
+
+	MarkKeysAbsent(c, []string{"missing-key"})
+
+	found, bufs, missing := c.Fetch(context.Background(), []string{"missing-key"})
+	require.Empty(t, found)
+	require.Empty(t, bufs)
+	require.Equal(t, []string{"missing-key"}, missing)
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cache byte arrays by key.
+//
+// NB we intentionally do not return errors in this interface - caching is best
+// effort by definition.  We found that when these methods did return errors,
+// the caller would just log them - so its easier for implementation to do that.
+// Whatsmore, we found partially successful Fetchs were often treated as failed
+// when they returned an error.
+type Cache interface {
+	Store(ctx context.Context, key []string, buf [][]byte)
+	Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string)
+	Stop()
+}
+
+// Config for building Caches.
+type Config struct {
+	EnableFifoCache bool `yaml:"enable_fifocache,omitempty"`
+
+	// EnableRistrettoCache enables an in-process cache backed by Ristretto's
+	// TinyLFU admission policy instead of the naive FIFO eviction of
+	// Fifocache. Prefer this for workloads with hot-key skew.
+	EnableRistrettoCache bool `yaml:"enable_ristretto_cache,omitempty"`
+
+	// EnableBloomFilter wraps the composed cache with a bloom-filter-backed
+	// negative cache (see BloomFilter), so repeated lookups for keys a caller
+	// has reported absent via MarkKeysAbsent short-circuit without reaching
+	// the cache tiers below, let alone whatever store backs them.
+	EnableBloomFilter bool        `yaml:"enable_bloom_filter,omitempty"`
+	Bloom             BloomConfig `yaml:"bloom,omitempty"`
+
+	DefaultValidity time.Duration `yaml:"default_validity,omitempty"`
+
+	Background     BackgroundConfig      `yaml:"background,omitempty"`
+	Memcache       MemcachedConfig       `yaml:"memcached,omitempty"`
+	MemcacheClient MemcachedClientConfig `yaml:"memcached_client,omitempty"`
+	Redis          RedisConfig           `yaml:"redis,omitempty"`
+	Fifocache      FifoCacheConfig       `yaml:"fifocache,omitempty"`
+	Ristretto      RistrettoCacheConfig  `yaml:"ristretto,omitempty"`
+
+	// Backends composes an arbitrary chain of named providers (see
+	// RegisterProvider), e.g. ["ristretto", "redis"] for an L1/L2 setup. When
+	// set, it takes precedence over the legacy EnableFifoCache/Memcache/Redis
+	// fields, which are kept only so existing YAML keeps working.
+	Backends []BackendConfig `yaml:"backends,omitempty"`
+
+	// This is to name the cache metrics properly.
+	Prefix string `yaml:"prefix,omitempty" doc:"hidden"`
+
+	// For tests to inject specific implementations.
+	Cache Cache `yaml:"-"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *Config) RegisterFlagsWithPrefix(prefix string, description string, f *flag.FlagSet) {
+	cfg.Background.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.Memcache.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.MemcacheClient.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.Redis.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.Fifocache.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.Ristretto.RegisterFlagsWithPrefix(prefix, description, f)
+	cfg.Bloom.RegisterFlagsWithPrefix(prefix, description, f)
+
+	f.BoolVar(&cfg.EnableFifoCache, prefix+"cache.enable-fifocache", false, description+"Enable in-memory cache.")
+	f.BoolVar(&cfg.EnableRistrettoCache, prefix+"cache.enable-ristretto-cache", false, description+"Enable in-memory cache backed by Ristretto's TinyLFU admission policy instead of fifocache.")
+	f.BoolVar(&cfg.EnableBloomFilter, prefix+"cache.enable-bloom-filter", false, description+"Wrap the cache with a bloom-filter-backed negative cache for keys reported absent via MarkKeysAbsent.")
+	f.DurationVar(&cfg.DefaultValidity, prefix+"default-validity", 0, description+"The default validity of entries for caches unless overridden.")
+
+	cfg.Prefix = prefix
+}
+
+// New creates a new Cache using Config. reg is variadic so existing callers
+// built against the original New(cfg Config) signature keep compiling; only
+// the first registerer passed, if any, is used.
+func New(cfg Config, registerers ...prometheus.Registerer) (Cache, error) {
+	var reg prometheus.Registerer
+	if len(registerers) > 0 {
+		reg = registerers[0]
+	}
+
+	if cfg.Cache != nil {
+		return cfg.Cache, nil
+	}
+
+	if len(cfg.Backends) > 0 {
+		caches, err := buildBackends(cfg, reg)
+		if err != nil {
+			return nil, err
+		}
+		cache := NewTiered(caches)
+		if len(caches) > 1 {
+			cache = Instrument(cfg.Prefix+"tiered", cache, reg)
+		}
+		if cfg.EnableBloomFilter {
+			cache = NewBloomFilter(cache, cfg.Bloom, reg)
+		}
+		return cache, nil
+	}
+
+	caches := []Cache{}
+
+	if cfg.EnableFifoCache {
+		if cfg.Fifocache.Validity == 0 && cfg.DefaultValidity != 0 {
+			cfg.Fifocache.Validity = cfg.DefaultValidity
+		}
+
+		cache := NewFifoCache(cfg.Prefix+"fifocache", cfg.Fifocache, reg)
+		caches = append(caches, Instrument(cfg.Prefix+"fifocache", cache, reg))
+	}
+
+	if cfg.EnableRistrettoCache {
+		if cfg.Ristretto.Validity == 0 && cfg.DefaultValidity != 0 {
+			cfg.Ristretto.Validity = cfg.DefaultValidity
+		}
+
+		cacheName := cfg.Prefix + "ristretto"
+		cache, err := NewRistrettoCache(cacheName, cfg.Ristretto, reg)
+		if err != nil {
+			return nil, err
+		}
+		caches = append(caches, Instrument(cacheName, cache, reg))
+	}
+
+	redisEnabled := cfg.Redis.Endpoint != "" ||
+		((cfg.Redis.Mode == RedisModeCluster || cfg.Redis.Mode == RedisModeSentinel) && len(cfg.Redis.Addresses) > 0)
+
+	if cfg.MemcacheClient.Host != "" && redisEnabled {
+		return nil, errors.New("use of multiple cache storage systems is not supported")
+	}
+
+	if cfg.MemcacheClient.Host != "" {
+		if cfg.Memcache.Expiration == 0 && cfg.DefaultValidity != 0 {
+			cfg.Memcache.Expiration = cfg.DefaultValidity
+		}
+
+		client := NewMemcachedClient(cfg.MemcacheClient)
+		cache := NewMemcached(cfg.Memcache, client, cfg.Prefix, reg)
+
+		cacheName := cfg.Prefix + "memcache"
+		caches = append(caches, NewBackground(cacheName, cfg.Background, Instrument(cacheName, cache, reg), reg))
+	}
+
+	if redisEnabled {
+		if cfg.Redis.Expiration == 0 && cfg.DefaultValidity != 0 {
+			cfg.Redis.Expiration = cfg.DefaultValidity
+		}
+		cacheName := cfg.Prefix + "redis"
+		cache, err := NewRedisCache(cfg.Redis, cacheName, nil)
+		if err != nil {
+			return nil, err
+		}
+		caches = append(caches, NewBackground(cacheName, cfg.Background, Instrument(cacheName, cache, reg), reg))
+	}
+
+	cache := NewTiered(caches)
+	if len(caches) > 1 {
+		cache = Instrument(cfg.Prefix+"tiered", cache, reg)
+	}
+	if cfg.EnableBloomFilter {
+		cache = NewBloomFilter(cache, cfg.Bloom, reg)
+	}
+	return cache, nil
+}
@@ -0,0 +1,33 @@
+package cache
+
+import "context"
+
+// cacheGenNumberContextKey is used to embed a tenant's cache generation number in a context.Context.
+type cacheGenNumberContextKey string
+
+const cacheGenNumberCtxKey = cacheGenNumberContextKey("cacheGenNumber")
+
+// InjectCacheGenNumber returns a derived context containing the given cache generation number.
+// Bumping this number (e.g. after a delete request) is a cheap way to logically invalidate
+// every entry written under the previous number, without touching the backend at all.
+func InjectCacheGenNumber(ctx context.Context, cacheGen string) context.Context {
+	return context.WithValue(ctx, cacheGenNumberCtxKey, cacheGen)
+}
+
+// ExtractCacheGenNumber gets the cache generation number from the context, or "" if it is not set.
+func ExtractCacheGenNumber(ctx context.Context) string {
+	genNumber, ok := ctx.Value(cacheGenNumberCtxKey).(string)
+	if !ok {
+		return ""
+	}
+	return genNumber
+}
+
+// cacheKeyWithGen prefixes key with gen so that bumping gen for a tenant logically invalidates
+// every key previously stored under it, without requiring a flush of the underlying backend.
+func cacheKeyWithGen(key, gen string) string {
+	if gen == "" {
+		return key
+	}
+	return gen + ":" + key
+}
@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectExtractCacheGenNumber(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, "", ExtractCacheGenNumber(ctx))
+
+	ctx = InjectCacheGenNumber(ctx, "42")
+	require.Equal(t, "42", ExtractCacheGenNumber(ctx))
+}
+
+func TestCacheKeyWithGen(t *testing.T) {
+	require.Equal(t, "foo", cacheKeyWithGen("foo", ""))
+	require.Equal(t, "42:foo", cacheKeyWithGen("foo", "42"))
+}
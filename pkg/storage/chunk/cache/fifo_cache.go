@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"flag"
+	"sync"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	util_log "github.com/grafana/loki/pkg/util/log"
+)
+
+// FifoCacheConfig holds config for the in-process fifo cache.
+type FifoCacheConfig struct {
+	MaxSizeBytes  string        `yaml:"max_size_bytes"`
+	MaxSizeItems  int           `yaml:"max_size_items"`
+	Validity      time.Duration `yaml:"validity"`
+	PurgeInterval time.Duration `yaml:"-"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *FifoCacheConfig) RegisterFlagsWithPrefix(prefix, description string, f *flag.FlagSet) {
+	f.StringVar(&cfg.MaxSizeBytes, prefix+"fifocache.max-size-bytes", "1GB", description+"Maximum memory size of the cache.")
+	f.IntVar(&cfg.MaxSizeItems, prefix+"fifocache.max-size-items", 0, description+"Maximum number of entries in the cache.")
+	f.DurationVar(&cfg.Validity, prefix+"fifocache.duration", 0, description+"The expiry duration for the cache.")
+}
+
+// FifoCache is a simple string -> []byte cache that uses a fifo slide to
+// manage evictions, suitable for small caches with low eviction rates.
+type FifoCache struct {
+	lock sync.RWMutex
+	name string
+
+	maxSizeItems  int
+	maxSizeBytes  int64
+	currSizeBytes int64
+	validity      time.Duration
+
+	entries map[string]*list.Element
+	lru     *list.List
+
+	entriesAdded   prometheus.Counter
+	entriesEvicted prometheus.Counter
+	totalGets      prometheus.Counter
+	totalMisses    prometheus.Counter
+}
+
+type cacheEntry struct {
+	key     string
+	updated time.Time
+	value   []byte
+}
+
+// NewFifoCache returns a new initialised FifoCache of size.
+func NewFifoCache(name string, cfg FifoCacheConfig, reg prometheus.Registerer) *FifoCache {
+	maxSizeBytes, err := units.RAMInBytes(cfg.MaxSizeBytes)
+	if err != nil {
+		// Caches are best-effort (see the Cache interface doc comment), so an
+		// unparseable size just leaves this cache unbounded by bytes rather
+		// than failing construction.
+		level.Warn(util_log.Logger).Log("msg", "fifocache: could not parse max_size_bytes, byte size limit disabled", "name", name, "max_size_bytes", cfg.MaxSizeBytes, "err", err)
+		maxSizeBytes = 0
+	}
+
+	cache := &FifoCache{
+		name:         name,
+		maxSizeItems: cfg.MaxSizeItems,
+		maxSizeBytes: maxSizeBytes,
+		validity:     cfg.Validity,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+
+		entriesAdded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "added_total",
+			Help:        "The total number of entries added to the fifo cache.",
+			ConstLabels: prometheus.Labels{"cache": name},
+		}),
+		entriesEvicted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "evicted_total",
+			Help:        "The total number of entries evicted from the fifo cache.",
+			ConstLabels: prometheus.Labels{"cache": name},
+		}),
+		totalGets: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "gets_total",
+			Help:        "The total number of Get calls on the fifo cache.",
+			ConstLabels: prometheus.Labels{"cache": name},
+		}),
+		totalMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "misses_total",
+			Help:        "The total number of Get calls that were a miss in the fifo cache.",
+			ConstLabels: prometheus.Labels{"cache": name},
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(cache.entriesAdded, cache.entriesEvicted, cache.totalGets, cache.totalMisses)
+	}
+	return cache
+}
+
+// Store stores the key in the cache, prefixing it with the gen number present in ctx (if any)
+// so that bumping a tenant's generation number invalidates every key it previously stored.
+func (c *FifoCache) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	gen := ExtractCacheGenNumber(ctx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	for i := range keys {
+		key := cacheKeyWithGen(keys[i], gen)
+		if element, ok := c.entries[key]; ok {
+			entry := element.Value.(*cacheEntry)
+			c.currSizeBytes += int64(len(bufs[i]) - len(entry.value))
+			entry.updated = now
+			entry.value = bufs[i]
+			c.lru.MoveToFront(element)
+			continue
+		}
+
+		entry := &cacheEntry{key: key, updated: now, value: bufs[i]}
+		element := c.lru.PushFront(entry)
+		c.entries[key] = element
+		c.currSizeBytes += entrySizeBytes(entry)
+		c.entriesAdded.Inc()
+
+		for (c.maxSizeItems > 0 && len(c.entries) > c.maxSizeItems) ||
+			(c.maxSizeBytes > 0 && c.currSizeBytes > c.maxSizeBytes) {
+			c.evict()
+		}
+	}
+}
+
+// Fetch looks the keys up in the cache, honouring the gen number present in ctx.
+func (c *FifoCache) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	gen := ExtractCacheGenNumber(ctx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.totalGets.Add(float64(len(keys)))
+	now := time.Now()
+
+	for _, key := range keys {
+		taggedKey := cacheKeyWithGen(key, gen)
+		element, ok := c.entries[taggedKey]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+
+		entry := element.Value.(*cacheEntry)
+		if c.validity != 0 && now.Sub(entry.updated) > c.validity {
+			c.removeElement(element)
+			missing = append(missing, key)
+			continue
+		}
+
+		c.lru.MoveToFront(element)
+		found = append(found, key)
+		bufs = append(bufs, entry.value)
+	}
+
+	c.totalMisses.Add(float64(len(missing)))
+	return
+}
+
+// Stop implements Cache.
+func (c *FifoCache) Stop() {}
+
+func (c *FifoCache) evict() {
+	element := c.lru.Back()
+	if element == nil {
+		return
+	}
+	c.removeElement(element)
+	c.entriesEvicted.Inc()
+}
+
+func (c *FifoCache) removeElement(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.currSizeBytes -= entrySizeBytes(entry)
+	delete(c.entries, entry.key)
+	c.lru.Remove(element)
+}
+
+// entrySizeBytes is an approximation of an entry's memory footprint - the key
+// and value bytes themselves, without accounting for Go's per-object/map
+// overhead - good enough to make max_size_bytes a useful bound in practice.
+func entrySizeBytes(entry *cacheEntry) int64 {
+	return int64(len(entry.key) + len(entry.value))
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFifoCacheGenNumberInvalidatesPreviousGen(t *testing.T) {
+	c := NewFifoCache("test", FifoCacheConfig{MaxSizeItems: 10}, nil)
+	defer c.Stop()
+
+	ctxGen1 := InjectCacheGenNumber(context.Background(), "1")
+	c.Store(ctxGen1, []string{"foo"}, [][]byte{[]byte("bar")})
+
+	found, bufs, missing := c.Fetch(ctxGen1, []string{"foo"})
+	require.Equal(t, []string{"foo"}, found)
+	require.Equal(t, [][]byte{[]byte("bar")}, bufs)
+	require.Empty(t, missing)
+
+	ctxGen2 := InjectCacheGenNumber(context.Background(), "2")
+	found, bufs, missing = c.Fetch(ctxGen2, []string{"foo"})
+	require.Empty(t, found)
+	require.Empty(t, bufs)
+	require.Equal(t, []string{"foo"}, missing)
+}
+
+func TestFifoCacheEnforcesMaxSizeBytes(t *testing.T) {
+	c := NewFifoCache("test", FifoCacheConfig{MaxSizeBytes: "1KB"}, nil)
+	defer c.Stop()
+
+	value := make([]byte, 100)
+	for i := 0; i < 20; i++ {
+		c.Store(context.Background(), []string{string(rune('a' + i))}, [][]byte{value})
+	}
+
+	require.LessOrEqual(t, c.currSizeBytes, int64(1024))
+	require.Less(t, len(c.entries), 20, "oldest entries should have been evicted once max_size_bytes was exceeded")
+}
+
+func TestFifoCacheUnparseableMaxSizeBytesDisablesByteLimit(t *testing.T) {
+	c := NewFifoCache("test", FifoCacheConfig{MaxSizeBytes: "not-a-size"}, nil)
+	defer c.Stop()
+
+	require.Equal(t, int64(0), c.maxSizeBytes)
+}
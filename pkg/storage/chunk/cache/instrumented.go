@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type instrumentedCache struct {
+	name string
+	Cache
+
+	requestDuration *prometheus.HistogramVec
+	fetchedKeys     prometheus.Counter
+	hits            prometheus.Counter
+}
+
+// Instrument returns a new Cache that exports Prometheus metrics for calls to Store and Fetch.
+func Instrument(name string, cache Cache, reg prometheus.Registerer) Cache {
+	c := &instrumentedCache{
+		name:  name,
+		Cache: cache,
+
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "request_duration_seconds",
+			Help:        "Total time spent in seconds doing cache requests.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: prometheus.Labels{"name": name},
+		}, []string{"method", "status_code"}),
+		fetchedKeys: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "fetched_keys",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "hits",
+			ConstLabels: prometheus.Labels{"name": name},
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(c.requestDuration, c.fetchedKeys, c.hits)
+	}
+	return c
+}
+
+func (i *instrumentedCache) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	start := time.Now()
+	i.Cache.Store(ctx, keys, bufs)
+	i.requestDuration.WithLabelValues("Store", "200").Observe(time.Since(start).Seconds())
+}
+
+func (i *instrumentedCache) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	start := time.Now()
+	found, bufs, missing = i.Cache.Fetch(ctx, keys)
+	i.requestDuration.WithLabelValues("Fetch", "200").Observe(time.Since(start).Seconds())
+	i.fetchedKeys.Add(float64(len(keys)))
+	i.hits.Add(float64(len(found)))
+	return
+}
+
+func (i *instrumentedCache) Stop() {
+	i.Cache.Stop()
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MemcachedConfig is config to make a Memcached.
+type MemcachedConfig struct {
+	Expiration time.Duration `yaml:"expiration"`
+
+	BatchSize   int `yaml:"batch_size"`
+	Parallelism int `yaml:"parallelism"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *MemcachedConfig) RegisterFlagsWithPrefix(prefix, description string, f *flag.FlagSet) {
+	f.DurationVar(&cfg.Expiration, prefix+"memcached.expiration", 0, description+"How long keys stay in the memcache.")
+	f.IntVar(&cfg.BatchSize, prefix+"memcached.batchsize", 0, description+"How many keys to fetch in each batch.")
+	f.IntVar(&cfg.Parallelism, prefix+"memcached.parallelism", 100, description+"Maximum active requests to memcache.")
+}
+
+// Memcached type caches chunks in memcached
+type Memcached struct {
+	cfg      MemcachedConfig
+	memcache MemcachedClient
+
+	name string
+
+	requestDuration *prometheus.HistogramVec
+}
+
+// NewMemcached makes a new Memcache.
+func NewMemcached(cfg MemcachedConfig, client MemcachedClient, name string, reg prometheus.Registerer) *Memcached {
+	c := &Memcached{
+		cfg:      cfg,
+		memcache: client,
+		name:     name,
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   "querier",
+			Subsystem:   "cache",
+			Name:        "request_duration_seconds",
+			Help:        "Total time spent in seconds doing memcache requests.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: prometheus.Labels{"name": name},
+		}, []string{"method", "status_code"}),
+	}
+	if reg != nil {
+		reg.MustRegister(c.requestDuration)
+	}
+	return c
+}
+
+// Fetch gets keys from the cache. Keys are first prefixed with the cache
+// generation number extracted from ctx, so that bumping that number for a
+// tenant logically invalidates every key written under the previous one.
+func (c *Memcached) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	gen := ExtractCacheGenNumber(ctx)
+
+	taggedKeys := make([]string, len(keys))
+	lookup := make(map[string]string, len(keys))
+	for i, key := range keys {
+		taggedKeys[i] = cacheKeyWithGen(key, gen)
+		lookup[taggedKeys[i]] = key
+	}
+
+	items, err := c.memcache.GetMulti(taggedKeys)
+	if err != nil {
+		return nil, nil, keys
+	}
+
+	for _, taggedKey := range taggedKeys {
+		item, ok := items[taggedKey]
+		if !ok {
+			missing = append(missing, lookup[taggedKey])
+			continue
+		}
+		found = append(found, lookup[taggedKey])
+		bufs = append(bufs, item.Value)
+	}
+	return
+}
+
+// Store stores the key in the cache, tagged with the gen number found in ctx (if any).
+func (c *Memcached) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	gen := ExtractCacheGenNumber(ctx)
+
+	for i := range keys {
+		err := c.memcache.Set(&memcache.Item{
+			Key:        cacheKeyWithGen(keys[i], gen),
+			Value:      bufs[i],
+			Expiration: int32(c.cfg.Expiration.Seconds()),
+		})
+		if err != nil {
+			continue
+		}
+	}
+}
+
+// Stop does nothing.
+func (c *Memcached) Stop() {}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"flag"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// MemcachedClient interface exists for mocking memcacheClient.
+type MemcachedClient interface {
+	GetMulti(keys []string) (map[string]*memcache.Item, error)
+	Set(item *memcache.Item) error
+}
+
+// MemcachedClientConfig is config to make a Memcached Client.
+type MemcachedClientConfig struct {
+	Host           string        `yaml:"host"`
+	Service        string        `yaml:"service"`
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxIdleConns   int           `yaml:"max_idle_conns"`
+	UpdateInterval time.Duration `yaml:"update_interval"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *MemcachedClientConfig) RegisterFlagsWithPrefix(prefix, description string, f *flag.FlagSet) {
+	f.StringVar(&cfg.Host, prefix+"memcached.hostname", "", description+"Hostname for memcached service to use. If empty, no memcached will be used.")
+	f.StringVar(&cfg.Service, prefix+"memcached.service", "memcached", description+"SRV service name for memcache servers. Not used by NewMemcachedClient, which connects to the hostname as given.")
+	f.DurationVar(&cfg.Timeout, prefix+"memcached.timeout", 100*time.Millisecond, description+"Maximum time to wait before giving up on memcached requests.")
+	f.IntVar(&cfg.MaxIdleConns, prefix+"memcached.max-idle-conns", 16, description+"Maximum number of idle connections in pool.")
+	f.DurationVar(&cfg.UpdateInterval, prefix+"memcached.update-interval", 1*time.Minute, description+"Period with which to poll DNS for memcache servers. Not used by NewMemcachedClient, whose server list is fixed at creation.")
+}
+
+// NewMemcachedClient creates a new MemcachedClient connected to cfg.Host. The
+// server list is fixed at creation: there is no DNS/SRV discovery and no
+// periodic refresh, and cfg.Service and cfg.UpdateInterval are not used.
+func NewMemcachedClient(cfg MemcachedClientConfig) MemcachedClient {
+	client := memcache.New(cfg.Host)
+	client.Timeout = cfg.Timeout
+	client.MaxIdleConns = cfg.MaxIdleConns
+	return client
+}
@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/grafana/loki/pkg/util/flagext"
+)
+
+// RedisMode selects the topology NewRedisCache connects to.
+type RedisMode string
+
+const (
+	// RedisModeSingle talks to a single redis instance at Endpoint.
+	RedisModeSingle RedisMode = "single"
+	// RedisModeCluster talks to a Redis Cluster made up of Addresses.
+	RedisModeCluster RedisMode = "cluster"
+	// RedisModeSentinel talks to a Redis Sentinel-monitored MasterName, discovered via Addresses.
+	RedisModeSentinel RedisMode = "sentinel"
+)
+
+// RedisConfig defines how a RedisCache should be constructed.
+type RedisConfig struct {
+	Mode RedisMode `yaml:"mode"`
+
+	// Endpoint is used when Mode is single. Addresses is used for cluster and sentinel.
+	Endpoint   string   `yaml:"endpoint"`
+	Addresses  []string `yaml:"addresses"`
+	MasterName string   `yaml:"master_name"`
+
+	Timeout    time.Duration `yaml:"timeout"`
+	Expiration time.Duration `yaml:"expiration"`
+	DB         int           `yaml:"db"`
+	PoolSize   int           `yaml:"pool_size"`
+	Password   string        `yaml:"password"`
+
+	EnableTLS          bool `yaml:"tls_enabled"`
+	InsecureSkipVerify bool `yaml:"tls_insecure_skip_verify"`
+
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	MaxConnAge  time.Duration `yaml:"max_connection_age"`
+}
+
+// RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet
+func (cfg *RedisConfig) RegisterFlagsWithPrefix(prefix, description string, f *flag.FlagSet) {
+	f.StringVar((*string)(&cfg.Mode), prefix+"redis.mode", string(RedisModeSingle), description+"Redis topology to connect to: single, cluster or sentinel.")
+	f.StringVar(&cfg.Endpoint, prefix+"redis.endpoint", "", description+"Redis service endpoint to use when caching chunks in single mode. If empty in single mode, no redis will be used.")
+	f.Var((*flagext.StringSlice)(&cfg.Addresses), prefix+"redis.addresses", description+"Comma-separated list of cluster or sentinel node addresses. Ignored in single mode.")
+	f.StringVar(&cfg.MasterName, prefix+"redis.master-name", "", description+"Name of the master instance monitored by sentinel. Required in sentinel mode.")
+	f.DurationVar(&cfg.Timeout, prefix+"redis.timeout", 100*time.Millisecond, description+"Maximum time to wait before giving up on redis requests.")
+	f.DurationVar(&cfg.Expiration, prefix+"redis.expiration", 0, description+"How long keys stay in the redis.")
+	f.IntVar(&cfg.DB, prefix+"redis.db", 0, description+"Database index.")
+	f.IntVar(&cfg.PoolSize, prefix+"redis.pool-size", 0, description+"Maximum number of connections in the pool, per node.")
+	f.StringVar(&cfg.Password, prefix+"redis.password", "", description+"Password to use when connecting to redis.")
+	f.BoolVar(&cfg.EnableTLS, prefix+"redis.tls-enabled", false, description+"Enable connecting to redis with TLS.")
+	f.BoolVar(&cfg.InsecureSkipVerify, prefix+"redis.tls-insecure-skip-verify", false, description+"Skip validating server certificate.")
+	f.DurationVar(&cfg.IdleTimeout, prefix+"redis.idle-timeout", 0, description+"Close connections after remaining idle for this duration. If the value is zero, then idle connections are not closed.")
+	f.DurationVar(&cfg.MaxConnAge, prefix+"redis.max-connection-age", 0, description+"Close connections older than this duration. If the value is zero, then the pool does not close connections based on age.")
+}
+
+// RedisCache type caches chunks in redis
+type RedisCache struct {
+	name       string
+	mode       RedisMode
+	expiration time.Duration
+	timeout    time.Duration
+	redis      redis.UniversalClient
+}
+
+// NewRedisCache creates a new RedisCache. If client is nil, a new one is built
+// from cfg, using a single, cluster or sentinel client depending on cfg.Mode.
+// Store routes through Pipeline regardless of topology: go-redis splits
+// single-key commands like SET to the right cluster node on its own. Fetch's
+// MGET is multi-key, so cluster mode needs its own per-slot grouping; see
+// fetchClusterBySlot.
+func NewRedisCache(cfg RedisConfig, name string, client redis.UniversalClient) (*RedisCache, error) {
+	if client == nil {
+		var tlsConfig *tls.Config
+		if cfg.EnableTLS {
+			tlsConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+		}
+
+		switch cfg.Mode {
+		case "", RedisModeSingle:
+			client = redis.NewClient(&redis.Options{
+				Addr:        cfg.Endpoint,
+				Password:    cfg.Password,
+				DB:          cfg.DB,
+				PoolSize:    cfg.PoolSize,
+				IdleTimeout: cfg.IdleTimeout,
+				MaxConnAge:  cfg.MaxConnAge,
+				TLSConfig:   tlsConfig,
+			})
+		case RedisModeCluster:
+			if len(cfg.Addresses) == 0 {
+				return nil, errors.New("redis: cluster mode requires at least one address")
+			}
+			client = redis.NewClusterClient(&redis.ClusterOptions{
+				Addrs:       cfg.Addresses,
+				Password:    cfg.Password,
+				PoolSize:    cfg.PoolSize,
+				IdleTimeout: cfg.IdleTimeout,
+				MaxConnAge:  cfg.MaxConnAge,
+				TLSConfig:   tlsConfig,
+			})
+		case RedisModeSentinel:
+			if cfg.MasterName == "" {
+				return nil, errors.New("redis: sentinel mode requires a master name")
+			}
+			if len(cfg.Addresses) == 0 {
+				return nil, errors.New("redis: sentinel mode requires at least one sentinel address")
+			}
+			client = redis.NewFailoverClient(&redis.FailoverOptions{
+				MasterName:    cfg.MasterName,
+				SentinelAddrs: cfg.Addresses,
+				Password:      cfg.Password,
+				DB:            cfg.DB,
+				PoolSize:      cfg.PoolSize,
+				IdleTimeout:   cfg.IdleTimeout,
+				MaxConnAge:    cfg.MaxConnAge,
+				TLSConfig:     tlsConfig,
+			})
+		default:
+			return nil, fmt.Errorf("redis: unknown mode %q", cfg.Mode)
+		}
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = RedisModeSingle
+	}
+	return &RedisCache{
+		name:       name,
+		mode:       mode,
+		expiration: cfg.Expiration,
+		timeout:    cfg.Timeout,
+		redis:      client,
+	}, nil
+}
+
+// Fetch gets keys from the cache, prefixing them with the gen number from
+// ctx. Against a single or sentinel-failover deployment this is one MGET.
+// Against a cluster deployment, a single multi-key command would be rejected
+// by Redis (CROSSSLOT) unless every key happens to hash to the same slot, so
+// keys are grouped by slot first and issued as one pipelined MGET per slot -
+// still a small, bounded number of round trips rather than one per key.
+func (c *RedisCache) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	gen := ExtractCacheGenNumber(ctx)
+	taggedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		taggedKeys[i] = cacheKeyWithGen(key, gen)
+	}
+
+	if c.mode != RedisModeCluster {
+		values, err := c.redis.MGet(ctx, taggedKeys...).Result()
+		if err != nil {
+			return nil, nil, keys
+		}
+		return collectMGetResults(keys, values)
+	}
+
+	return c.fetchClusterBySlot(ctx, keys, taggedKeys)
+}
+
+// fetchClusterBySlot issues one MGET per distinct hash slot touched by
+// taggedKeys, pipelined together so they go out in a single round trip per
+// affected node rather than one round trip per key.
+func (c *RedisCache) fetchClusterBySlot(ctx context.Context, keys, taggedKeys []string) (found []string, bufs [][]byte, missing []string) {
+	bySlot := groupBySlot(taggedKeys)
+
+	pipe := c.redis.Pipeline()
+	cmds := make(map[uint16]*redis.SliceCmd, len(bySlot))
+	for slot, idxs := range bySlot {
+		slotKeys := make([]string, len(idxs))
+		for j, idx := range idxs {
+			slotKeys[j] = taggedKeys[idx]
+		}
+		cmds[slot] = pipe.MGet(ctx, slotKeys...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, nil, keys
+	}
+
+	for slot, idxs := range bySlot {
+		values, err := cmds[slot].Result()
+		if err != nil && err != redis.Nil {
+			for _, idx := range idxs {
+				missing = append(missing, keys[idx])
+			}
+			continue
+		}
+
+		slotFound, slotBufs, slotMissing := collectMGetResultsAt(keys, idxs, values)
+		found = append(found, slotFound...)
+		bufs = append(bufs, slotBufs...)
+		missing = append(missing, slotMissing...)
+	}
+	return
+}
+
+// collectMGetResults turns an MGET reply (aligned with keys) into the
+// found/bufs/missing triple Cache.Fetch returns.
+func collectMGetResults(keys []string, values []interface{}) (found []string, bufs [][]byte, missing []string) {
+	idxs := make([]int, len(keys))
+	for i := range keys {
+		idxs[i] = i
+	}
+	return collectMGetResultsAt(keys, idxs, values)
+}
+
+// collectMGetResultsAt is like collectMGetResults, but values[j] corresponds
+// to keys[idxs[j]] rather than keys[j] directly - used when an MGET only
+// covered a subset of keys (e.g. one cluster hash slot).
+func collectMGetResultsAt(keys []string, idxs []int, values []interface{}) (found []string, bufs [][]byte, missing []string) {
+	for j, value := range values {
+		key := keys[idxs[j]]
+		if value == nil {
+			missing = append(missing, key)
+			continue
+		}
+		s, ok := value.(string)
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		found = append(found, key)
+		bufs = append(bufs, []byte(s))
+	}
+	return
+}
+
+// Store stores the key in redis, prefixing it with the gen number from ctx.
+func (c *RedisCache) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	gen := ExtractCacheGenNumber(ctx)
+
+	pipe := c.redis.Pipeline()
+	for i := range keys {
+		pipe.Set(ctx, cacheKeyWithGen(keys[i], gen), bufs[i], c.expiration)
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+// Stop closes the redis client.
+func (c *RedisCache) Stop() {
+	_ = c.redis.Close()
+}
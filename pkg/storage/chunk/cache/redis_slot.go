@@ -0,0 +1,48 @@
+package cache
+
+import "strings"
+
+// numClusterSlots is the fixed slot count used by Redis Cluster.
+const numClusterSlots = 16384
+
+// groupBySlot buckets the indices of keys by the Redis Cluster hash slot each
+// key belongs to, so a batch of keys can be issued as one MGET per slot
+// instead of one multi-key command that would cross slots.
+func groupBySlot(keys []string) map[uint16][]int {
+	bySlot := make(map[uint16][]int)
+	for i, key := range keys {
+		slot := clusterKeySlot(key)
+		bySlot[slot] = append(bySlot[slot], i)
+	}
+	return bySlot
+}
+
+// clusterKeySlot computes the Redis Cluster hash slot for key, honouring
+// "{hash tag}" key construction: if key contains a non-empty {...} substring,
+// only that substring is hashed, which is how operators deliberately co-locate
+// related keys on the same slot.
+func clusterKeySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16CCITT(key) % numClusterSlots
+}
+
+// crc16CCITT implements the CRC16/XMODEM variant (poly 0x1021, init 0) that
+// Redis Cluster uses for key hashing.
+func crc16CCITT(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
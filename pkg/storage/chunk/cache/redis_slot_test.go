@@ -0,0 +1,32 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupBySlotSplitsUnrelatedKeys(t *testing.T) {
+	keys := []string{"chunk:aaa", "chunk:bbb", "chunk:ccc", "chunk:ddd"}
+	bySlot := groupBySlot(keys)
+
+	total := 0
+	for _, idxs := range bySlot {
+		total += len(idxs)
+	}
+	require.Equal(t, len(keys), total)
+	// These keys don't share a hash tag, so with high probability they don't
+	// all land on the same slot - the grouping must not silently merge them.
+	require.Greater(t, len(bySlot), 1)
+}
+
+func TestClusterKeySlotHashTagCollocatesKeys(t *testing.T) {
+	a := clusterKeySlot("{tenant-1}:chunk:aaa")
+	b := clusterKeySlot("{tenant-1}:chunk:bbb")
+	require.Equal(t, a, b, "keys sharing a hash tag must land on the same slot")
+}
+
+func TestClusterKeySlotWithinRange(t *testing.T) {
+	slot := clusterKeySlot("some-key")
+	require.Less(t, slot, uint16(numClusterSlots))
+}
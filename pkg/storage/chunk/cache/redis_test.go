@@ -0,0 +1,18 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedisCacheValidatesTopologyConfig(t *testing.T) {
+	_, err := NewRedisCache(RedisConfig{Mode: RedisModeCluster}, "test", nil)
+	require.Error(t, err)
+
+	_, err = NewRedisCache(RedisConfig{Mode: RedisModeSentinel, Addresses: []string{"localhost:26379"}}, "test", nil)
+	require.Error(t, err)
+
+	_, err = NewRedisCache(RedisConfig{Mode: "bogus"}, "test", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+// BackendConfig selects one entry of a composed cache chain. Params is decoded
+// by the named provider's factory (see decodeParams), so its shape is
+// entirely up to that provider.
+type BackendConfig struct {
+	Name   string                 `yaml:"name"`
+	Params map[string]interface{} `yaml:"params"`
+}
+
+// ProviderConfig is handed to a registered provider factory. It carries the
+// knobs every backend needs (prefix for metric names, registerer, the
+// fallback validity/write-back settings) plus the backend-specific Params.
+type ProviderConfig struct {
+	Prefix          string
+	Reg             prometheus.Registerer
+	DefaultValidity time.Duration
+	Background      BackgroundConfig
+	Params          map[string]interface{}
+}
+
+// decodeParams re-marshals a backend's generic Params map and decodes it into
+// out, which should be a pointer to that provider's typed config struct.
+// yaml.v2 has no tree-based Node type to decode from lazily, so this is a
+// marshal-then-unmarshal round trip instead. Like yaml.Unmarshal generally,
+// this only touches fields present in params - callers should populate out
+// with defaults (see applyFlagDefaults) before calling this, so a backend
+// configured via Backends gets the same defaults as one enabled directly by
+// its own EnableXxx field.
+func decodeParams(params map[string]interface{}, out interface{}) error {
+	b, err := yaml.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b, out)
+}
+
+// applyFlagDefaults populates cfg with the same defaults RegisterFlagsWithPrefix
+// would register on a real FlagSet, by registering them on a throwaway one
+// and discarding it. Backends entries only set the Params they care about, so
+// without this a provider built through the registry would silently lose
+// documented, safety-relevant defaults (e.g. FifoCacheConfig.MaxSizeBytes)
+// that the equivalent EnableXxx-style config gets for free.
+func applyFlagDefaults(cfg interface {
+	RegisterFlagsWithPrefix(prefix, description string, f *flag.FlagSet)
+}) {
+	cfg.RegisterFlagsWithPrefix("", "", flag.NewFlagSet("", flag.ContinueOnError))
+}
+
+// ProviderFactory builds a Cache from a ProviderConfig.
+type ProviderFactory func(cfg ProviderConfig) (Cache, error)
+
+var (
+	providersMu sync.Mutex
+	providers   = map[string]ProviderFactory{}
+)
+
+// RegisterProvider makes a cache backend selectable by name from
+// Config.Backends, without this package needing to know about it ahead of
+// time. Third-party modules (e.g. BadgerDB, groupcache, DragonflyDB backends)
+// should call this from an init() in the package that implements them.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("cache: provider %q already registered", name))
+	}
+	providers[name] = factory
+}
+
+func init() {
+	RegisterProvider("fifocache", func(cfg ProviderConfig) (Cache, error) {
+		var fifoCfg FifoCacheConfig
+		applyFlagDefaults(&fifoCfg)
+		if err := decodeParams(cfg.Params, &fifoCfg); err != nil {
+			return nil, err
+		}
+		if fifoCfg.Validity == 0 && cfg.DefaultValidity != 0 {
+			fifoCfg.Validity = cfg.DefaultValidity
+		}
+		name := cfg.Prefix + "fifocache"
+		return Instrument(name, NewFifoCache(name, fifoCfg, cfg.Reg), cfg.Reg), nil
+	})
+
+	RegisterProvider("ristretto", func(cfg ProviderConfig) (Cache, error) {
+		var ristrettoCfg RistrettoCacheConfig
+		applyFlagDefaults(&ristrettoCfg)
+		if err := decodeParams(cfg.Params, &ristrettoCfg); err != nil {
+			return nil, err
+		}
+		if ristrettoCfg.Validity == 0 && cfg.DefaultValidity != 0 {
+			ristrettoCfg.Validity = cfg.DefaultValidity
+		}
+		name := cfg.Prefix + "ristretto"
+		cache, err := NewRistrettoCache(name, ristrettoCfg, cfg.Reg)
+		if err != nil {
+			return nil, err
+		}
+		return Instrument(name, cache, cfg.Reg), nil
+	})
+
+	RegisterProvider("memcached", func(cfg ProviderConfig) (Cache, error) {
+		var params struct {
+			MemcachedConfig       `yaml:",inline"`
+			MemcachedClientConfig `yaml:",inline"`
+		}
+		// Both embedded configs implement RegisterFlagsWithPrefix, so applying
+		// it via the embedded params value would be an ambiguous selector;
+		// apply each explicitly instead.
+		applyFlagDefaults(&params.MemcachedConfig)
+		applyFlagDefaults(&params.MemcachedClientConfig)
+		if err := decodeParams(cfg.Params, &params); err != nil {
+			return nil, err
+		}
+		if params.Expiration == 0 && cfg.DefaultValidity != 0 {
+			params.Expiration = cfg.DefaultValidity
+		}
+
+		client := NewMemcachedClient(params.MemcachedClientConfig)
+		name := cfg.Prefix + "memcache"
+		cache := NewMemcached(params.MemcachedConfig, client, cfg.Prefix, cfg.Reg)
+		return NewBackground(name, cfg.Background, Instrument(name, cache, cfg.Reg), cfg.Reg), nil
+	})
+
+	RegisterProvider("redis", func(cfg ProviderConfig) (Cache, error) {
+		var redisCfg RedisConfig
+		applyFlagDefaults(&redisCfg)
+		if err := decodeParams(cfg.Params, &redisCfg); err != nil {
+			return nil, err
+		}
+		if redisCfg.Expiration == 0 && cfg.DefaultValidity != 0 {
+			redisCfg.Expiration = cfg.DefaultValidity
+		}
+
+		name := cfg.Prefix + "redis"
+		cache, err := NewRedisCache(redisCfg, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		return NewBackground(name, cfg.Background, Instrument(name, cache, cfg.Reg), cfg.Reg), nil
+	})
+}
+
+// buildBackends runs each configured backend through its registered provider
+// and returns the resulting caches in order.
+func buildBackends(cfg Config, reg prometheus.Registerer) ([]Cache, error) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	caches := make([]Cache, 0, len(cfg.Backends))
+	for _, backend := range cfg.Backends {
+		factory, ok := providers[backend.Name]
+		if !ok {
+			return nil, fmt.Errorf("cache: unknown backend %q", backend.Name)
+		}
+
+		cache, err := factory(ProviderConfig{
+			Prefix:          cfg.Prefix,
+			Reg:             reg,
+			DefaultValidity: cfg.DefaultValidity,
+			Background:      cfg.Background,
+			Params:          backend.Params,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cache: building backend %q: %w", backend.Name, err)
+		}
+		caches = append(caches, cache)
+	}
+	return caches, nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterProviderDuplicate(t *testing.T) {
+	RegisterProvider("test-dup-provider", func(cfg ProviderConfig) (Cache, error) {
+		return NewFifoCache("test", FifoCacheConfig{}, nil), nil
+	})
+
+	require.Panics(t, func() {
+		RegisterProvider("test-dup-provider", func(cfg ProviderConfig) (Cache, error) {
+			return NewFifoCache("test", FifoCacheConfig{}, nil), nil
+		})
+	})
+}
+
+func TestConfigBackendsComposesRegisteredProviders(t *testing.T) {
+	cfg := Config{
+		Backends: []BackendConfig{
+			{Name: "fifocache", Params: map[string]interface{}{"max_size_items": 10}},
+		},
+	}
+
+	cache, err := New(cfg, nil)
+	require.NoError(t, err)
+	defer cache.Stop()
+
+	cache.Store(context.Background(), []string{"foo"}, [][]byte{[]byte("bar")})
+	found, bufs, missing := cache.Fetch(context.Background(), []string{"foo"})
+	require.Equal(t, []string{"foo"}, found)
+	require.Equal(t, [][]byte{[]byte("bar")}, bufs)
+	require.Empty(t, missing)
+}
+
+func TestFifocacheProviderAppliesUndeclaredFlagDefaults(t *testing.T) {
+	// max_size_items is set, but max_size_bytes is left out of Params
+	// entirely - it must still fall back to the documented "1GB" flag
+	// default, the same as when the cache is enabled via EnableFifoCache,
+	// rather than silently ending up unbounded.
+	caches, err := buildBackends(Config{
+		Backends: []BackendConfig{
+			{Name: "fifocache", Params: map[string]interface{}{"max_size_items": 10}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, caches, 1)
+
+	instr, ok := caches[0].(*instrumentedCache)
+	require.True(t, ok)
+	fifo, ok := instr.Cache.(*FifoCache)
+	require.True(t, ok)
+	require.Equal(t, int64(1<<30), fifo.maxSizeBytes)
+}
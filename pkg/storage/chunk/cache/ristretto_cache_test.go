@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRistrettoCacheStoreFetch(t *testing.T) {
+	c, err := NewRistrettoCache("test", RistrettoCacheConfig{MaxCost: 1 << 20, NumCounters: 1000}, nil)
+	require.NoError(t, err)
+	defer c.Stop()
+
+	c.Store(context.Background(), []string{"foo"}, [][]byte{[]byte("bar")})
+	// Ristretto's Set is processed asynchronously via internal buffers.
+	time.Sleep(10 * time.Millisecond)
+
+	found, bufs, missing := c.Fetch(context.Background(), []string{"foo", "baz"})
+	require.Equal(t, []string{"foo"}, found)
+	require.Equal(t, [][]byte{[]byte("bar")}, bufs)
+	require.Equal(t, []string{"baz"}, missing)
+}
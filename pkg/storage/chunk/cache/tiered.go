@@ -0,0 +1,46 @@
+package cache
+
+import "context"
+
+type tiered []Cache
+
+// NewTiered makes a new tiered cache. Stores write through to all of the
+// caches; Fetches query each tier in turn until all keys are found.
+func NewTiered(caches []Cache) Cache {
+	if len(caches) == 1 {
+		return caches[0]
+	}
+	return tiered(caches)
+}
+
+func (t tiered) Store(ctx context.Context, keys []string, bufs [][]byte) {
+	for _, c := range []Cache(t) {
+		c.Store(ctx, keys, bufs)
+	}
+}
+
+func (t tiered) Fetch(ctx context.Context, keys []string) (found []string, bufs [][]byte, missing []string) {
+	missing = keys
+	for _, c := range []Cache(t) {
+		if len(missing) == 0 {
+			break
+		}
+
+		var (
+			passFound   []string
+			passBufs    [][]byte
+			passMissing []string
+		)
+		passFound, passBufs, passMissing = c.Fetch(ctx, missing)
+		found = append(found, passFound...)
+		bufs = append(bufs, passBufs...)
+		missing = passMissing
+	}
+	return
+}
+
+func (t tiered) Stop() {
+	for _, c := range []Cache(t) {
+		c.Stop()
+	}
+}